@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AdminConfig controls the runtime admin API mounted under /api/.
+type AdminConfig struct {
+	Enabled bool `json:"enabled"`
+	// Token is the bearer token required on every admin request.
+	Token string `json:"token"`
+}
+
+// addBackendRequest is the body of POST /api/backends.
+type addBackendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// patchBackendRequest is the body of PATCH /api/backends/{id}.
+type patchBackendRequest struct {
+	Weight *int  `json:"weight"`
+	Drain  *bool `json:"drain"`
+}
+
+// setPolicyRequest is the body of PUT /api/policy.
+type setPolicyRequest struct {
+	Policy string `json:"policy"`
+	Header string `json:"header"` // only used when Policy == "header_hash"
+}
+
+// handleAdmin routes an authenticated /api/* request to the runtime admin
+// API: adding, patching (weight/drain), and removing backends, switching the
+// selection policy, and reading the running config.
+func (lb *LoadBalancer) handleAdmin(w http.ResponseWriter, r *http.Request) {
+	if !lb.authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/api/backends" && r.Method == http.MethodPost:
+		lb.handleAddBackend(w, r)
+	case strings.HasPrefix(r.URL.Path, "/api/backends/") && r.Method == http.MethodDelete:
+		lb.handleRemoveBackend(w, r, strings.TrimPrefix(r.URL.Path, "/api/backends/"))
+	case strings.HasPrefix(r.URL.Path, "/api/backends/") && r.Method == http.MethodPatch:
+		lb.handlePatchBackend(w, r, strings.TrimPrefix(r.URL.Path, "/api/backends/"))
+	case r.URL.Path == "/api/policy" && r.Method == http.MethodPut:
+		lb.handleSetPolicy(w, r)
+	case r.URL.Path == "/api/config" && r.Method == http.MethodGet:
+		lb.handleGetConfig(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (lb *LoadBalancer) authenticateAdmin(r *http.Request) bool {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	token := strings.TrimPrefix(header, prefix)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(lb.Admin.Token)) == 1
+}
+
+func (lb *LoadBalancer) handleAddBackend(w http.ResponseWriter, r *http.Request) {
+	var req addBackendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	weight := req.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	server := &Server{ID: serverID(req.URL), URL: req.URL, Weight: weight, Healthy: true}
+
+	lb.Mutex.Lock()
+	servers := make([]*Server, len(lb.Servers), len(lb.Servers)+1)
+	copy(servers, lb.Servers)
+	lb.Servers = append(servers, server)
+	lb.Mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(server)
+}
+
+func (lb *LoadBalancer) handleRemoveBackend(w http.ResponseWriter, r *http.Request, id string) {
+	lb.Mutex.Lock()
+	servers := make([]*Server, 0, len(lb.Servers))
+	removed := false
+	for _, s := range lb.Servers {
+		if s.ID == id {
+			removed = true
+			continue
+		}
+		servers = append(servers, s)
+	}
+	if removed {
+		lb.Servers = servers
+	}
+	lb.Mutex.Unlock()
+
+	if !removed {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (lb *LoadBalancer) handlePatchBackend(w http.ResponseWriter, r *http.Request, id string) {
+	var req patchBackendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	lb.Mutex.Lock()
+	servers := lb.Servers
+	lb.Mutex.Unlock()
+
+	var server *Server
+	for _, s := range servers {
+		if s.ID == id {
+			server = s
+			break
+		}
+	}
+	if server == nil {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	server.Mutex.Lock()
+	if req.Weight != nil && *req.Weight > 0 {
+		server.Weight = *req.Weight
+	}
+	if req.Drain != nil {
+		server.Draining = *req.Drain
+	}
+	server.Mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(server)
+}
+
+func (lb *LoadBalancer) handleSetPolicy(w http.ResponseWriter, r *http.Request) {
+	var req setPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var policy SelectionPolicy
+	var err error
+	if req.Policy == "header_hash" {
+		policy = NewHeaderHashPolicy(req.Header)
+	} else {
+		policy, err = NewSelectionPolicy(req.Policy)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lb.Mutex.Lock()
+	lb.Policy = policy
+	lb.Mutex.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (lb *LoadBalancer) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	lb.Mutex.Lock()
+	policy := lb.Policy
+	servers := lb.Servers
+	lb.Mutex.Unlock()
+
+	policyName := ""
+	if policy != nil {
+		policyName = policy.Name()
+	}
+
+	backends := make([]map[string]interface{}, 0, len(servers))
+	for _, s := range servers {
+		s.Mutex.Lock()
+		backends = append(backends, map[string]interface{}{
+			"id":       s.ID,
+			"url":      s.URL,
+			"weight":   s.Weight,
+			"healthy":  s.Healthy,
+			"draining": s.Draining,
+		})
+		s.Mutex.Unlock()
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"policy":         policyName,
+		"stickySessions": lb.Sticky.Enabled,
+		"passiveHealth":  lb.PassiveHealth,
+		"backends":       backends,
+	})
+}
+
+// reapDrainedServers removes draining backends once their in-flight
+// connections have bled down to zero.
+func (lb *LoadBalancer) reapDrainedServers() {
+	lb.Mutex.Lock()
+	defer lb.Mutex.Unlock()
+
+	kept := make([]*Server, 0, len(lb.Servers))
+	for _, s := range lb.Servers {
+		s.Mutex.Lock()
+		drained := s.Draining && s.ActiveConnections == 0
+		s.Mutex.Unlock()
+		if drained {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	lb.Servers = kept
+}
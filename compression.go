@@ -0,0 +1,163 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressionConfig controls response compression for proxied responses.
+// When Enabled, ModifyResponse negotiates an encoding from Accept-Encoding
+// (preferring brotli over gzip) and streams the response body through the
+// matching compressor instead of passing it through unmodified.
+type CompressionConfig struct {
+	Enabled bool `json:"enabled"`
+	// MinSize is the smallest Content-Length, in bytes, worth compressing.
+	// Responses without a known Content-Length are compressed regardless.
+	MinSize int `json:"minSize"`
+	// IncludedContentTypes lists the Content-Type prefixes eligible for
+	// compression. Defaults to text/*, application/json,
+	// application/javascript, application/xml, and image/svg+xml.
+	IncludedContentTypes []string `json:"includedContentTypes"`
+	// ExcludedPaths lists request path prefixes that are never compressed.
+	ExcludedPaths []string `json:"excludedPaths"`
+}
+
+func (c CompressionConfig) minSize() int {
+	if c.MinSize <= 0 {
+		return 256
+	}
+	return c.MinSize
+}
+
+var defaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+func (c CompressionConfig) includedContentTypes() []string {
+	if len(c.IncludedContentTypes) > 0 {
+		return c.IncludedContentTypes
+	}
+	return defaultCompressibleTypes
+}
+
+func (c CompressionConfig) isExcludedPath(path string) bool {
+	for _, prefix := range c.ExcludedPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CompressionConfig) isCompressibleType(contentType string) bool {
+	base := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	for _, prefix := range c.includedContentTypes() {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks "br", "gzip", or "" (no compression) from an
+// Accept-Encoding header, preferring brotli when both are acceptable.
+// An encoding listed with "q=0" is explicitly refused and never picked.
+func negotiateEncoding(acceptEncoding string) string {
+	br, gzip := false, false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.TrimSpace(fields[0])
+		if acceptEncodingQuality(fields[1:]) == 0 {
+			continue
+		}
+		switch name {
+		case "br":
+			br = true
+		case "gzip":
+			gzip = true
+		}
+	}
+	switch {
+	case br:
+		return "br"
+	case gzip:
+		return "gzip"
+	default:
+		return ""
+	}
+}
+
+// acceptEncodingQuality parses the "q=..." parameter from an Accept-Encoding
+// entry's parameter list, defaulting to 1 when absent or malformed.
+func acceptEncodingQuality(params []string) float64 {
+	for _, param := range params {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || strings.TrimSpace(name) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 1
+		}
+		return q
+	}
+	return 1
+}
+
+// compressResponse rewrites resp in place to stream its body through the
+// encoding negotiated from r's Accept-Encoding header, provided resp is
+// eligible (not already encoded, not a HEAD/304, content type and size
+// match the config, and path isn't excluded). It is a no-op otherwise.
+func (c CompressionConfig) compressResponse(resp *http.Response, path string) {
+	if !c.Enabled || c.isExcludedPath(path) {
+		return
+	}
+	if resp.Request.Method == http.MethodHead || resp.StatusCode == http.StatusNotModified {
+		return
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	if !c.isCompressibleType(resp.Header.Get("Content-Type")) {
+		return
+	}
+	if length, err := strconv.Atoi(resp.Header.Get("Content-Length")); err == nil && length < c.minSize() {
+		return
+	}
+
+	encoding := negotiateEncoding(resp.Request.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	var compressor io.WriteCloser
+	if encoding == "br" {
+		compressor = brotli.NewWriter(pw)
+	} else {
+		compressor = gzip.NewWriter(pw)
+	}
+
+	body := resp.Body
+	go func() {
+		_, err := io.Copy(compressor, body)
+		compressor.Close()
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+
+	resp.Body = pr
+	resp.Header.Set("Content-Encoding", encoding)
+	resp.Header.Add("Vary", "Accept-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
@@ -0,0 +1,200 @@
+package main
+
+import "time"
+
+// CircuitState tracks a server's passive-health circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed is the normal state: the server receives traffic and
+	// outcomes are monitored.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means recent failures tripped the breaker; the server is
+	// marked unhealthy and skipped until its backoff elapses.
+	CircuitOpen
+	// CircuitHalfOpen means the backoff elapsed and the server is back in
+	// rotation on a trial basis: one more failure reopens the circuit with a
+	// longer backoff, while a success closes it.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// outcomeRecord is one entry in a Server's rolling passive-health window.
+type outcomeRecord struct {
+	at      time.Time
+	success bool
+}
+
+// minPassiveSamples is the smallest window size the failure-rate threshold
+// will act on, so a single unlucky request can't trip the breaker on its own.
+const minPassiveSamples = 5
+
+// PassiveHealthConfig controls passive health checking and circuit breaking,
+// layered on top of the active /health probes in HealthCheck.
+type PassiveHealthConfig struct {
+	// MaxFails opens the circuit after this many consecutive failures,
+	// regardless of sample size. 0 disables this rule.
+	MaxFails int `json:"maxFails"`
+	// FailTimeout is the base backoff (e.g. "30s") before a half-open probe
+	// is allowed through; it doubles on each repeated trip.
+	FailTimeout string `json:"failTimeout"`
+	// WindowSeconds is the size of the rolling outcome window used to
+	// compute FailureRateThreshold. Defaults to 10.
+	WindowSeconds int `json:"windowSeconds"`
+	// FailureRateThreshold opens the circuit when the failure rate over the
+	// window meets or exceeds this value (0-1), once at least
+	// minPassiveSamples outcomes have been recorded. 0 disables this rule.
+	FailureRateThreshold float64 `json:"failureRateThreshold"`
+	// UnhealthyStatusCodes marks these response codes as failures. Defaults
+	// to any 5xx status.
+	UnhealthyStatusCodes []int `json:"unhealthyStatusCodes"`
+	// UnhealthyLatencyThresholdMs marks a response as a failure if it takes
+	// longer than this to complete. 0 disables the latency rule.
+	UnhealthyLatencyThresholdMs int `json:"unhealthyLatencyThresholdMs"`
+}
+
+func (c PassiveHealthConfig) window() time.Duration {
+	if c.WindowSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.WindowSeconds) * time.Second
+}
+
+func (c PassiveHealthConfig) failTimeout() time.Duration {
+	d, err := time.ParseDuration(c.FailTimeout)
+	if err != nil || d <= 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+func (c PassiveHealthConfig) latencyThreshold() time.Duration {
+	if c.UnhealthyLatencyThresholdMs <= 0 {
+		return 0
+	}
+	return time.Duration(c.UnhealthyLatencyThresholdMs) * time.Millisecond
+}
+
+func (c PassiveHealthConfig) isUnhealthyStatus(code int) bool {
+	if len(c.UnhealthyStatusCodes) == 0 {
+		return code >= 500
+	}
+	for _, sc := range c.UnhealthyStatusCodes {
+		if sc == code {
+			return true
+		}
+	}
+	return false
+}
+
+// passiveBackoffDuration returns the half-open backoff for the attempt'th
+// circuit trip (1-indexed), doubling each time and capped at 16x base.
+func passiveBackoffDuration(base time.Duration, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := base
+	for i := 1; i < attempt && backoff < base*16; i++ {
+		backoff *= 2
+	}
+	if backoff > base*16 {
+		backoff = base * 16
+	}
+	return backoff
+}
+
+// recordOutcome records a single request outcome against s's rolling window
+// and opens, closes, or keeps the circuit breaker accordingly.
+func (lb *LoadBalancer) recordOutcome(s *Server, success bool) {
+	cfg := lb.PassiveHealth
+	now := time.Now()
+
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.outcomes = append(s.outcomes, outcomeRecord{at: now, success: success})
+	cutoff := now.Add(-cfg.window())
+	kept := s.outcomes[:0]
+	for _, o := range s.outcomes {
+		if o.at.After(cutoff) {
+			kept = append(kept, o)
+		}
+	}
+	s.outcomes = kept
+
+	if success {
+		s.ConsecutiveFailures = 0
+		if s.CircuitState == CircuitHalfOpen {
+			s.CircuitState = CircuitClosed
+			s.backoffAttempt = 0
+			s.Healthy = true
+		}
+		return
+	}
+
+	s.Failures++
+	s.ConsecutiveFailures++
+	s.LastFailure = now
+
+	if s.CircuitState == CircuitHalfOpen {
+		// The trial request failed: reopen with a longer backoff.
+		s.CircuitState = CircuitOpen
+		s.CircuitOpenedAt = now
+		s.Healthy = false
+		s.backoffAttempt++
+		return
+	}
+
+	fails := 0
+	for _, o := range s.outcomes {
+		if !o.success {
+			fails++
+		}
+	}
+	rate := float64(fails) / float64(len(s.outcomes))
+
+	tripped := cfg.MaxFails > 0 && s.ConsecutiveFailures >= cfg.MaxFails
+	if !tripped && cfg.FailureRateThreshold > 0 && len(s.outcomes) >= minPassiveSamples {
+		tripped = rate >= cfg.FailureRateThreshold
+	}
+
+	if tripped && s.CircuitState != CircuitOpen {
+		s.CircuitState = CircuitOpen
+		s.CircuitOpenedAt = now
+		s.backoffAttempt++
+		s.Healthy = false
+	}
+}
+
+// admitHalfOpenProbes flips servers whose open-circuit backoff has elapsed
+// into the half-open state, letting the next request through as a trial.
+func (lb *LoadBalancer) admitHalfOpenProbes() {
+	cfg := lb.PassiveHealth
+	now := time.Now()
+
+	lb.Mutex.Lock()
+	servers := lb.Servers
+	lb.Mutex.Unlock()
+
+	for _, s := range servers {
+		s.Mutex.Lock()
+		if s.CircuitState == CircuitOpen {
+			backoff := passiveBackoffDuration(cfg.failTimeout(), s.backoffAttempt)
+			if now.Sub(s.CircuitOpenedAt) >= backoff {
+				s.CircuitState = CircuitHalfOpen
+				s.Healthy = true
+			}
+		}
+		s.Mutex.Unlock()
+	}
+}
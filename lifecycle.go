@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// connTrackingBody wraps a proxied response body so ActiveConnections is
+// decremented once the body is fully read or closed, rather than as soon as
+// headers come back in ModifyResponse, so long-streamed responses are
+// counted as in-flight for their whole duration.
+type connTrackingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *connTrackingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *connTrackingBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// healthCheckSupervisor owns the background health-check goroutine's
+// lifecycle so it can be restarted with a new interval on config reload
+// without leaking the previous ticker.
+type healthCheckSupervisor struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// restart cancels any running health-check loop and starts a new one with
+// interval, derived from parent so canceling parent also stops it.
+func (s *healthCheckSupervisor) restart(parent context.Context, lb *LoadBalancer, interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	s.cancel = cancel
+	go lb.HealthCheck(ctx, interval)
+}
+
+// reloadServers diffs configs against the running Servers: URLs no longer
+// present are marked draining (reapDrainedServers removes them once their
+// connections bleed to zero), URLs that remain have their weight updated,
+// and new URLs are added.
+func (lb *LoadBalancer) reloadServers(configs []ServerConfig) {
+	desired := make(map[string]ServerConfig, len(configs))
+	for _, c := range configs {
+		desired[c.URL] = c
+	}
+
+	lb.Mutex.Lock()
+	present := make(map[string]bool, len(lb.Servers))
+	kept := make([]*Server, 0, len(lb.Servers)+len(configs))
+	for _, s := range lb.Servers {
+		present[s.URL] = true
+		c, wanted := desired[s.URL]
+
+		s.Mutex.Lock()
+		s.Draining = !wanted
+		if wanted && c.Weight > 0 {
+			s.Weight = c.Weight
+		}
+		s.Mutex.Unlock()
+
+		kept = append(kept, s)
+	}
+
+	added := 0
+	for _, c := range configs {
+		if present[c.URL] {
+			continue
+		}
+		weight := c.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		kept = append(kept, &Server{ID: serverID(c.URL), URL: c.URL, Weight: weight, Healthy: true})
+		added++
+	}
+	lb.Servers = kept
+	lb.Mutex.Unlock()
+
+	log.Printf("Config reload: %d backend(s) added, %d configured total", added, len(configs))
+}
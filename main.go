@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,30 +9,93 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 // Server represents a backend server
 type Server struct {
-	URL              string
-	Healthy          bool
+	ID      string
+	URL     string
+	Weight  int
+	Healthy bool
+	// Draining means the server should stop receiving new requests but
+	// keep serving the ones already in flight; see reapDrainedServers.
+	Draining          bool
 	ActiveConnections int
-	TotalRequests    int
-	Mutex            sync.Mutex
+	TotalRequests     int
+	StickyHits        int
+
+	// Passive health / circuit breaker state, guarded by Mutex like
+	// everything else on Server. See recordOutcome in health.go.
+	Failures            int
+	ConsecutiveFailures int
+	LastFailure         time.Time
+	CircuitState        CircuitState
+	CircuitOpenedAt     time.Time
+	backoffAttempt      int
+	outcomes            []outcomeRecord
+
+	Mutex sync.Mutex
 }
 
 // LoadBalancer manages a pool of servers
 type LoadBalancer struct {
-	Servers []*Server
-	Mutex   sync.Mutex
+	Servers       []*Server
+	Policy        SelectionPolicy
+	Sticky        StickyConfig
+	PassiveHealth PassiveHealthConfig
+	Metrics       *Metrics
+	MetricsPath   string
+	AccessLog     AccessLogger
+	Admin         AdminConfig
+	Compression   CompressionConfig
+	// Ctx is canceled when the server begins shutting down, so in-flight
+	// handlers can reject newly-arriving requests instead of proxying to a
+	// backend that's about to lose its health checks.
+	Ctx   context.Context
+	Mutex sync.Mutex
+}
+
+// serverID derives a stable backend id from its URL, used by the admin API.
+func serverID(serverURL string) string {
+	return fmt.Sprintf("%08x", fnv1aHash(serverURL))
+}
+
+// ServerConfig describes one backend in config.json, including its optional
+// load-balancing weight (used by the "weighted" policy; defaults to 1).
+type ServerConfig struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
 }
 
 // Config holds the load balancer configuration
 type Config struct {
-	ListenPort          string   `json:"listenPort"`
-	HealthCheckInterval string   `json:"healthCheckInterval"`
-	Servers             []string `json:"servers"`
+	ListenPort          string         `json:"listenPort"`
+	HealthCheckInterval string         `json:"healthCheckInterval"`
+	Servers             []ServerConfig `json:"servers"`
+	// Policy selects the SelectionPolicy used to route requests, e.g.
+	// "round_robin", "random", "weighted", "ip_hash", "header_hash",
+	// "uri_hash", "least_requests", or "least_connections" (the default).
+	Policy string `json:"policy"`
+	// HeaderHashHeader names the request header hashed by the "header_hash"
+	// policy. Only used when Policy is "header_hash".
+	HeaderHashHeader string `json:"headerHashHeader"`
+	// StickySessions configures optional cookie-based session affinity.
+	StickySessions StickyConfig `json:"stickySessions"`
+	// PassiveHealth configures passive health checking and circuit breaking.
+	PassiveHealth PassiveHealthConfig `json:"passiveHealth"`
+	// Metrics configures the Prometheus /metrics endpoint.
+	Metrics MetricsConfig `json:"metrics"`
+	// AccessLog configures the structured JSON access log.
+	AccessLog AccessLogConfig `json:"accessLog"`
+	// Admin configures the runtime admin API mounted under /api/.
+	Admin AdminConfig `json:"admin"`
+	// Compression configures response compression for proxied responses.
+	Compression CompressionConfig `json:"compression"`
 }
 
 // LoadConfig loads configuration from a JSON file
@@ -48,50 +112,76 @@ func LoadConfig(file string) (Config, error) {
 	return config, err
 }
 
-// GetLeastConnectedServer returns the server with the least active connections
-func (lb *LoadBalancer) GetLeastConnectedServer() *Server {
+// SelectServer chooses the server that should handle r using the load
+// balancer's configured SelectionPolicy, defaulting to LeastConnectionsPolicy
+// if none was set.
+func (lb *LoadBalancer) SelectServer(r *http.Request) *Server {
 	lb.Mutex.Lock()
-	defer lb.Mutex.Unlock()
+	servers := lb.Servers
+	policy := lb.Policy
+	lb.Mutex.Unlock()
 
-	var leastConnectedServer *Server
-	leastConnections := -1
-
-	for _, server := range lb.Servers {
-		server.Mutex.Lock()
-		if !server.Healthy {
-			server.Mutex.Unlock()
-			continue
-		}
-
-		if leastConnections == -1 || server.ActiveConnections < leastConnections {
-			leastConnections = server.ActiveConnections
-			leastConnectedServer = server
-		}
-		server.Mutex.Unlock()
+	if policy == nil {
+		policy = &LeastConnectionsPolicy{}
 	}
 
-	return leastConnectedServer
+	selected := policy.Select(servers, r)
+	if selected != nil && lb.Metrics != nil {
+		lb.Metrics.SelectionTotal.WithLabelValues(policy.Name(), selected.URL).Inc()
+	}
+	return selected
 }
 
-// HealthCheck periodically checks the health of all servers
-func (lb *LoadBalancer) HealthCheck(interval time.Duration) {
+// HealthCheck periodically probes /health on all servers and, on the same
+// cadence, lets the passive circuit breaker admit half-open trial traffic.
+// It returns when ctx is canceled, e.g. on shutdown or a SIGHUP-triggered
+// interval change.
+func (lb *LoadBalancer) HealthCheck(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
-		<-ticker.C
-		for _, server := range lb.Servers {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		lb.admitHalfOpenProbes()
+		lb.reapDrainedServers()
+
+		lb.Mutex.Lock()
+		servers := lb.Servers
+		lb.Mutex.Unlock()
+
+		for _, server := range servers {
 			go func(s *Server) {
 				client := http.Client{
 					Timeout: 5 * time.Second,
 				}
+				start := time.Now()
 				resp, err := client.Get(s.URL + "/health")
-				
-				s.Mutex.Lock()
-				s.Healthy = err == nil && resp != nil && resp.StatusCode == http.StatusOK
+				active := err == nil && resp != nil && resp.StatusCode == http.StatusOK
 				if resp != nil {
 					resp.Body.Close()
 				}
+
+				s.Mutex.Lock()
+				// While the passive circuit breaker is open, it alone
+				// decides when the server is re-admitted; don't let an
+				// active probe silently undo that.
+				if s.CircuitState != CircuitOpen {
+					s.Healthy = active
+				}
+				healthy := s.Healthy
 				s.Mutex.Unlock()
-				
+
+				if lb.Metrics != nil {
+					lb.Metrics.HealthCheckDuration.WithLabelValues(s.URL).Observe(time.Since(start).Seconds())
+					lb.Metrics.setBackendUp(s.URL, healthy)
+					if !active {
+						lb.Metrics.HealthCheckFailures.WithLabelValues(s.URL).Inc()
+					}
+				}
+
 				if err != nil {
 					log.Printf("Health check failed for %s: %s", s.URL, err)
 				}
@@ -109,10 +199,17 @@ func (lb *LoadBalancer) GetStats() []map[string]interface{} {
 	for _, server := range lb.Servers {
 		server.Mutex.Lock()
 		serverStats := map[string]interface{}{
-			"url":               server.URL,
-			"healthy":           server.Healthy,
-			"activeConnections": server.ActiveConnections,
-			"totalRequests":     server.TotalRequests,
+			"id":                  server.ID,
+			"url":                 server.URL,
+			"healthy":             server.Healthy,
+			"draining":            server.Draining,
+			"weight":              server.Weight,
+			"activeConnections":   server.ActiveConnections,
+			"totalRequests":       server.TotalRequests,
+			"stickyHits":          server.StickyHits,
+			"circuitState":        server.CircuitState.String(),
+			"failures":            server.Failures,
+			"consecutiveFailures": server.ConsecutiveFailures,
 		}
 		server.Mutex.Unlock()
 		stats = append(stats, serverStats)
@@ -123,13 +220,30 @@ func (lb *LoadBalancer) GetStats() []map[string]interface{} {
 
 // ServeHTTP handles incoming requests and forwards them to backend servers
 func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if lb.Ctx != nil && lb.Ctx.Err() != nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Serve Prometheus metrics before anything else
+	if lb.Metrics != nil && r.URL.Path == lb.MetricsPath {
+		lb.Metrics.Handler().ServeHTTP(w, r)
+		return
+	}
+
 	// Handle API requests for the dashboard
 	if r.URL.Path == "/api/server-stats" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(lb.GetStats())
 		return
 	}
-	
+
+	// Handle the runtime admin API
+	if lb.Admin.Enabled && strings.HasPrefix(r.URL.Path, "/api/") {
+		lb.handleAdmin(w, r)
+		return
+	}
+
 	// Serve the dashboard
 	if r.URL.Path == "/" || r.URL.Path == "/dashboard" {
 		http.ServeFile(w, r, "dashboard.html")
@@ -137,11 +251,28 @@ func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle load balancing for other requests
-	server := lb.GetLeastConnectedServer()
+	var server *Server
+	sticky := false
+	if lb.Sticky.Enabled {
+		if server = lb.stickyServer(r); server != nil {
+			sticky = true
+		}
+	}
+	if server == nil {
+		server = lb.SelectServer(r)
+		if server != nil && lb.Sticky.Enabled {
+			lb.setAffinityCookie(w, server)
+		}
+	}
 	if server == nil {
 		http.Error(w, "No healthy servers available", http.StatusServiceUnavailable)
 		return
 	}
+	if sticky {
+		server.Mutex.Lock()
+		server.StickyHits++
+		server.Mutex.Unlock()
+	}
 
 	// Parse the URL
 	targetURL, err := url.Parse(server.URL)
@@ -154,35 +285,89 @@ func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	server.Mutex.Lock()
 	server.ActiveConnections++
 	server.TotalRequests++
+	activeConnections := server.ActiveConnections
 	server.Mutex.Unlock()
+	if lb.Metrics != nil {
+		lb.Metrics.setActiveConnections(server.URL, activeConnections)
+	}
+
+	start := time.Now()
+	traceID := generateTraceID()
+	method := r.Method
+	path := r.URL.Path
 
 	// Create a reverse proxy
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
-	
+	if lb.Metrics != nil {
+		proxy.Transport = &instrumentedTransport{backend: server.URL, metrics: lb.Metrics, base: http.DefaultTransport}
+	}
+
 	// Define the director func
 	originalDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
 		req.Header.Set("X-Forwarded-Host", req.Host)
 		req.Header.Set("X-Origin-Host", targetURL.Host)
+		req.Header.Set("X-Trace-Id", traceID)
 	}
 
-	// Modify the response to handle connection tracking
+	// Modify the response to handle connection tracking, passive health, and
+	// access logging.
 	proxy.ModifyResponse = func(resp *http.Response) error {
-		time.Sleep(5 * time.Second)
-		server.Mutex.Lock()
-		server.ActiveConnections--
-		server.Mutex.Unlock()
+		lb.Compression.compressResponse(resp, path)
+
+		resp.Body = &connTrackingBody{ReadCloser: resp.Body, release: func() {
+			server.Mutex.Lock()
+			server.ActiveConnections--
+			activeConnections := server.ActiveConnections
+			server.Mutex.Unlock()
+			if lb.Metrics != nil {
+				lb.Metrics.setActiveConnections(server.URL, activeConnections)
+			}
+		}}
+
+		success := !lb.PassiveHealth.isUnhealthyStatus(resp.StatusCode)
+		if threshold := lb.PassiveHealth.latencyThreshold(); threshold > 0 && time.Since(start) > threshold {
+			success = false
+		}
+		lb.recordOutcome(server, success)
+
+		lb.AccessLog.Log(AccessLogEntry{
+			Time:    start,
+			Backend: server.URL,
+			Method:  method,
+			Path:    path,
+			Status:  resp.StatusCode,
+			Bytes:   resp.ContentLength,
+			Latency: time.Since(start),
+			TraceID: traceID,
+		})
 		return nil
 	}
 
-	// Handle errors
+	// Handle errors: record the outcome and let the passive health layer
+	// decide whether this trips the circuit, rather than flipping Healthy
+	// on a single failure.
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		server.Mutex.Lock()
 		server.ActiveConnections--
-		server.Healthy = false // Mark as unhealthy if proxy fails
+		activeConnections := server.ActiveConnections
 		server.Mutex.Unlock()
-		
+		if lb.Metrics != nil {
+			lb.Metrics.setActiveConnections(server.URL, activeConnections)
+		}
+		lb.recordOutcome(server, false)
+
+		lb.AccessLog.Log(AccessLogEntry{
+			Time:    start,
+			Backend: server.URL,
+			Method:  method,
+			Path:    path,
+			Status:  http.StatusBadGateway,
+			Latency: time.Since(start),
+			TraceID: traceID,
+		})
+
 		http.Error(w, "Error proxying request: "+err.Error(), http.StatusBadGateway)
 	}
 
@@ -197,17 +382,60 @@ func main() {
 		config = Config{
 			ListenPort:          ":8080",
 			HealthCheckInterval: "10s",
-			Servers:             []string{"http://localhost:8081", "http://localhost:8082"},
+			Servers: []ServerConfig{
+				{URL: "http://localhost:8081"},
+				{URL: "http://localhost:8082"},
+			},
+		}
+	}
+
+	// Build the selection policy
+	var policy SelectionPolicy
+	if config.Policy == "header_hash" {
+		policy = NewHeaderHashPolicy(config.HeaderHashHeader)
+	} else {
+		policy, err = NewSelectionPolicy(config.Policy)
+		if err != nil {
+			log.Fatalf("Invalid selection policy: %s", err)
 		}
 	}
 
+	// Build the observability subsystem
+	var metrics *Metrics
+	if config.Metrics.Enabled {
+		metrics = NewMetrics()
+	}
+
+	accessLog, err := newAccessLogger(config.AccessLog)
+	if err != nil {
+		log.Fatalf("Invalid access log configuration: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// Initialize load balancer
-	lb := &LoadBalancer{}
-	
+	lb := &LoadBalancer{
+		Policy:        policy,
+		Sticky:        config.StickySessions,
+		PassiveHealth: config.PassiveHealth,
+		Metrics:       metrics,
+		MetricsPath:   config.Metrics.path(),
+		AccessLog:     accessLog,
+		Admin:         config.Admin,
+		Compression:   config.Compression,
+		Ctx:           ctx,
+	}
+
 	// Initialize servers
-	for _, serverURL := range config.Servers {
+	for _, server := range config.Servers {
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
 		lb.Servers = append(lb.Servers, &Server{
-			URL:     serverURL,
+			ID:      serverID(server.URL),
+			URL:     server.URL,
+			Weight:  weight,
 			Healthy: true,
 		})
 	}
@@ -217,14 +445,55 @@ func main() {
 	if err != nil {
 		interval = 10 * time.Second
 	}
-	go lb.HealthCheck(interval)
+	var healthChecks healthCheckSupervisor
+	healthChecks.restart(ctx, lb, interval)
 
 	// Create dashboard.html file
 	createDashboardFile()
 
+	server := &http.Server{Addr: config.ListenPort, Handler: lb}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
+	go func() {
+		for sig := range sigCh {
+			switch sig {
+			case syscall.SIGHUP:
+				log.Println("Received SIGHUP, reloading config.json")
+				newConfig, err := LoadConfig("config.json")
+				if err != nil {
+					log.Printf("Config reload failed: %s", err)
+					continue
+				}
+				lb.reloadServers(newConfig.Servers)
+				if newInterval, err := time.ParseDuration(newConfig.HealthCheckInterval); err == nil && newInterval != interval {
+					interval = newInterval
+					healthChecks.restart(ctx, lb, interval)
+				}
+			case syscall.SIGINT, syscall.SIGTERM:
+				log.Println("Shutting down")
+				cancel()
+				shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := server.Shutdown(shutdownCtx); err != nil {
+					log.Printf("Graceful shutdown failed: %s", err)
+				}
+				shutdownCancel()
+				close(shutdownDone)
+				return
+			}
+		}
+	}()
+
 	// Start the server
 	fmt.Printf("Load balancer starting on port %s\n", config.ListenPort)
-	log.Fatal(http.ListenAndServe(config.ListenPort, lb))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server error: %s", err)
+	}
+	// Wait for the SIGINT/SIGTERM handler to finish draining in-flight
+	// requests before the process exits; ListenAndServe returns as soon as
+	// Shutdown is called, well before Shutdown itself has finished waiting.
+	<-shutdownDone
 }
 
 // createDashboardFile creates the HTML file for the dashboard
@@ -251,7 +520,7 @@ func createDashboardFile() {
         <h1>Load Balancer Dashboard</h1>
         
         <div class="refresh-rate">
-            Refresh rate: 
+            Refresh rate:
             <select id="refresh-rate">
                 <option value="1000">1 second</option>
                 <option value="5000" selected>5 seconds</option>
@@ -259,11 +528,16 @@ func createDashboardFile() {
                 <option value="30000">30 seconds</option>
             </select>
         </div>
-        
+
+        <div class="refresh-rate">
+            Admin token (for drain/remove/weight actions):
+            <input type="password" id="admin-token" placeholder="Bearer token">
+        </div>
+
         <div class="chart-container">
             <canvas id="loadChart"></canvas>
         </div>
-        
+
         <h2>Server Status</h2>
         <table id="serverTable">
             <thead>
@@ -272,6 +546,10 @@ func createDashboardFile() {
                     <th>Status</th>
                     <th>Active Connections</th>
                     <th>Total Requests</th>
+                    <th>Sticky Hits</th>
+                    <th>Circuit</th>
+                    <th>Weight</th>
+                    <th>Admin</th>
                 </tr>
             </thead>
             <tbody id="serverTableBody">
@@ -339,19 +617,72 @@ func createDashboardFile() {
                     
                     const requestsCell = document.createElement('td');
                     requestsCell.textContent = server.totalRequests;
-                    
+
+                    const stickyCell = document.createElement('td');
+                    stickyCell.textContent = server.stickyHits;
+
+                    const circuitCell = document.createElement('td');
+                    circuitCell.textContent = server.circuitState;
+
+                    const weightCell = document.createElement('td');
+                    const weightInput = document.createElement('input');
+                    weightInput.type = 'number';
+                    weightInput.min = '1';
+                    weightInput.value = server.weight;
+                    weightInput.style.width = '4em';
+                    weightInput.addEventListener('change', () => patchBackend(server.id, { weight: parseInt(weightInput.value) }));
+                    weightCell.appendChild(weightInput);
+
+                    const adminCell = document.createElement('td');
+                    const drainButton = document.createElement('button');
+                    drainButton.textContent = server.draining ? 'Undrain' : 'Drain';
+                    drainButton.addEventListener('click', () => patchBackend(server.id, { drain: !server.draining }));
+                    const removeButton = document.createElement('button');
+                    removeButton.textContent = 'Remove';
+                    removeButton.addEventListener('click', () => removeBackend(server.id));
+                    adminCell.appendChild(drainButton);
+                    adminCell.appendChild(removeButton);
+
                     row.appendChild(urlCell);
                     row.appendChild(statusCell);
                     row.appendChild(connectionsCell);
                     row.appendChild(requestsCell);
-                    
+                    row.appendChild(stickyCell);
+                    row.appendChild(circuitCell);
+                    row.appendChild(weightCell);
+                    row.appendChild(adminCell);
+
                     tableBody.appendChild(row);
                 });
             } catch (error) {
                 console.error('Error fetching server stats:', error);
             }
         }
-        
+
+        // Admin helpers: mutate a backend via the runtime admin API
+        function adminHeaders() {
+            const token = document.getElementById('admin-token').value;
+            return { 'Authorization': 'Bearer ' + token, 'Content-Type': 'application/json' };
+        }
+
+        async function patchBackend(id, body) {
+            try {
+                await fetch('/api/backends/' + id, { method: 'PATCH', headers: adminHeaders(), body: JSON.stringify(body) });
+                updateStats();
+            } catch (error) {
+                console.error('Error patching backend:', error);
+            }
+        }
+
+        async function removeBackend(id) {
+            try {
+                await fetch('/api/backends/' + id, { method: 'DELETE', headers: adminHeaders() });
+                updateStats();
+            } catch (error) {
+                console.error('Error removing backend:', error);
+            }
+        }
+
         // Set up refresh rate change handler
         document.getElementById('refresh-rate').addEventListener('change', function() {
             const rate = parseInt(this.value);
@@ -367,7 +698,7 @@ func createDashboardFile() {
         });
     </script>
 </body>
-</html>`;
+</html>`
 
 	err := os.WriteFile("dashboard.html", []byte(dashboard), 0644)
 	if err != nil {
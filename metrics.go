@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsConfig controls the Prometheus /metrics endpoint.
+type MetricsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Path defaults to "/metrics" when empty.
+	Path string `json:"path"`
+}
+
+func (c MetricsConfig) path() string {
+	if c.Path == "" {
+		return "/metrics"
+	}
+	return c.Path
+}
+
+// Metrics holds the load balancer's Prometheus collectors, registered
+// against their own Registry so this package doesn't pollute the global one.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	RequestsTotal       *prometheus.CounterVec
+	RequestDuration     *prometheus.HistogramVec
+	ActiveConnections   *prometheus.GaugeVec
+	BackendUp           *prometheus.GaugeVec
+	HealthCheckDuration *prometheus.HistogramVec
+	HealthCheckFailures *prometheus.CounterVec
+	SelectionTotal      *prometheus.CounterVec
+}
+
+// NewMetrics builds and registers the load balancer's metric collectors.
+func NewMetrics() *Metrics {
+	reg := prometheus.NewRegistry()
+	factory := promauto.With(reg)
+
+	reg.MustRegister(prometheus.NewGoCollector())
+	reg.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	return &Metrics{
+		Registry: reg,
+		RequestsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lb_requests_total",
+			Help: "Total proxied requests, labeled by backend, response code, and method.",
+		}, []string{"backend", "code", "method"}),
+		RequestDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "lb_request_duration_seconds",
+			Help:    "Upstream request duration in seconds, labeled by backend.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"backend"}),
+		ActiveConnections: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "lb_active_connections",
+			Help: "In-flight connections per backend.",
+		}, []string{"backend"}),
+		BackendUp: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "lb_backend_up",
+			Help: "Whether a backend is currently considered healthy (1) or not (0).",
+		}, []string{"backend"}),
+		HealthCheckDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "lb_health_check_duration_seconds",
+			Help:    "Active health probe duration in seconds, labeled by backend.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"backend"}),
+		HealthCheckFailures: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lb_health_check_failures_total",
+			Help: "Total failed active health probes, labeled by backend.",
+		}, []string{"backend"}),
+		SelectionTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "lb_selection_total",
+			Help: "Total times a backend was chosen by the selection policy, labeled by policy and backend.",
+		}, []string{"policy", "backend"}),
+	}
+}
+
+// Handler returns the HTTP handler serving this Metrics' registry.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// instrumentedTransport wraps a RoundTripper to record per-backend request
+// count and latency at the point the upstream actually responds, so timings
+// reflect the real round trip rather than anything ModifyResponse does.
+type instrumentedTransport struct {
+	backend string
+	metrics *Metrics
+	base    http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	duration := time.Since(start).Seconds()
+
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	t.metrics.RequestDuration.WithLabelValues(t.backend).Observe(duration)
+	t.metrics.RequestsTotal.WithLabelValues(t.backend, code, req.Method).Inc()
+
+	return resp, err
+}
+
+// setActiveConnections updates the active-connections gauge for a backend.
+func (m *Metrics) setActiveConnections(backend string, n int) {
+	m.ActiveConnections.WithLabelValues(backend).Set(float64(n))
+}
+
+// setBackendUp updates the up/down gauge for a backend.
+func (m *Metrics) setBackendUp(backend string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	m.BackendUp.WithLabelValues(backend).Set(value)
+}
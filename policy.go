@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SelectionPolicy picks a backend server for an incoming request. Implementations
+// must only consider healthy servers and return nil when none are available.
+type SelectionPolicy interface {
+	// Name identifies the policy, e.g. for the "policy" config field and admin API.
+	Name() string
+	// Select returns the server that should handle r, or nil if no healthy
+	// server is available.
+	Select(servers []*Server, r *http.Request) *Server
+}
+
+// healthyServers returns the subset of servers currently eligible for traffic.
+func healthyServers(servers []*Server) []*Server {
+	healthy := make([]*Server, 0, len(servers))
+	for _, s := range servers {
+		s.Mutex.Lock()
+		ok := s.Healthy && !s.Draining
+		s.Mutex.Unlock()
+		if ok {
+			healthy = append(healthy, s)
+		}
+	}
+	return healthy
+}
+
+// NewSelectionPolicy builds the SelectionPolicy named by policy, as used by the
+// "policy" config field and the admin API's PUT /api/policy.
+func NewSelectionPolicy(policy string) (SelectionPolicy, error) {
+	switch policy {
+	case "", "least_connections":
+		return &LeastConnectionsPolicy{}, nil
+	case "round_robin":
+		return &RoundRobinPolicy{}, nil
+	case "random":
+		return &RandomPolicy{}, nil
+	case "weighted":
+		return NewWeightedPolicy(), nil
+	case "ip_hash":
+		return &IPHashPolicy{}, nil
+	case "header_hash":
+		return nil, fmt.Errorf("header_hash policy requires a header name, use NewHeaderHashPolicy")
+	case "uri_hash":
+		return &URIHashPolicy{}, nil
+	case "least_requests":
+		return &LeastRequestsPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown selection policy %q", policy)
+	}
+}
+
+// LeastConnectionsPolicy routes to the healthy server with the fewest active
+// connections. This is the load balancer's original, and default, behavior.
+type LeastConnectionsPolicy struct{}
+
+func (p *LeastConnectionsPolicy) Name() string { return "least_connections" }
+
+func (p *LeastConnectionsPolicy) Select(servers []*Server, r *http.Request) *Server {
+	var best *Server
+	bestConnections := -1
+
+	for _, server := range servers {
+		server.Mutex.Lock()
+		if !server.Healthy || server.Draining {
+			server.Mutex.Unlock()
+			continue
+		}
+		if bestConnections == -1 || server.ActiveConnections < bestConnections {
+			bestConnections = server.ActiveConnections
+			best = server
+		}
+		server.Mutex.Unlock()
+	}
+
+	return best
+}
+
+// LeastRequestsPolicy routes to the healthy server with the fewest lifetime
+// requests, which tends to favor recently-added backends.
+type LeastRequestsPolicy struct{}
+
+func (p *LeastRequestsPolicy) Name() string { return "least_requests" }
+
+func (p *LeastRequestsPolicy) Select(servers []*Server, r *http.Request) *Server {
+	var best *Server
+	bestRequests := -1
+
+	for _, server := range servers {
+		server.Mutex.Lock()
+		if !server.Healthy || server.Draining {
+			server.Mutex.Unlock()
+			continue
+		}
+		if bestRequests == -1 || server.TotalRequests < bestRequests {
+			bestRequests = server.TotalRequests
+			best = server
+		}
+		server.Mutex.Unlock()
+	}
+
+	return best
+}
+
+// RoundRobinPolicy cycles through healthy servers in order.
+type RoundRobinPolicy struct {
+	mu  sync.Mutex
+	idx uint64
+}
+
+func (p *RoundRobinPolicy) Name() string { return "round_robin" }
+
+func (p *RoundRobinPolicy) Select(servers []*Server, r *http.Request) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	i := p.idx % uint64(len(healthy))
+	p.idx++
+	p.mu.Unlock()
+
+	return healthy[i]
+}
+
+// RandomPolicy picks uniformly at random among healthy servers.
+type RandomPolicy struct{}
+
+func (p *RandomPolicy) Name() string { return "random" }
+
+func (p *RandomPolicy) Select(servers []*Server, r *http.Request) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[rand.Intn(len(healthy))]
+}
+
+// WeightedPolicy implements smooth weighted round robin: each healthy server
+// accumulates its configured Weight every selection, the highest accumulator
+// wins, and the total weight is subtracted back off the winner. This spreads
+// traffic evenly in proportion to weight rather than bursting to one server.
+type WeightedPolicy struct {
+	mu      sync.Mutex
+	current map[*Server]int
+}
+
+func NewWeightedPolicy() *WeightedPolicy {
+	return &WeightedPolicy{current: make(map[*Server]int)}
+}
+
+func (p *WeightedPolicy) Name() string { return "weighted" }
+
+func (p *WeightedPolicy) Select(servers []*Server, r *http.Request) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	total := 0
+	var best *Server
+	bestCurrent := 0
+	for _, s := range healthy {
+		weight := s.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		p.current[s] += weight
+		total += weight
+		if best == nil || p.current[s] > bestCurrent {
+			best = s
+			bestCurrent = p.current[s]
+		}
+	}
+	if best != nil {
+		p.current[best] -= total
+	}
+	return best
+}
+
+// IPHashPolicy consistently hashes the client IP (X-Forwarded-For if present,
+// else RemoteAddr) onto the current set of healthy servers, so a given client
+// tends to land on the same backend as long as it stays healthy.
+type IPHashPolicy struct{}
+
+func (p *IPHashPolicy) Name() string { return "ip_hash" }
+
+func (p *IPHashPolicy) Select(servers []*Server, r *http.Request) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+	idx := fnv1aHash(clientIP(r)) % uint32(len(healthy))
+	return healthy[idx]
+}
+
+// HeaderHashPolicy consistently hashes a configurable request header onto the
+// current set of healthy servers.
+type HeaderHashPolicy struct {
+	Header string
+}
+
+func NewHeaderHashPolicy(header string) *HeaderHashPolicy {
+	return &HeaderHashPolicy{Header: header}
+}
+
+func (p *HeaderHashPolicy) Name() string { return "header_hash" }
+
+func (p *HeaderHashPolicy) Select(servers []*Server, r *http.Request) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+	idx := fnv1aHash(r.Header.Get(p.Header)) % uint32(len(healthy))
+	return healthy[idx]
+}
+
+// URIHashPolicy consistently hashes the request path onto the current set of
+// healthy servers, useful for cache-friendly routing.
+type URIHashPolicy struct{}
+
+func (p *URIHashPolicy) Name() string { return "uri_hash" }
+
+func (p *URIHashPolicy) Select(servers []*Server, r *http.Request) *Server {
+	healthy := healthyServers(servers)
+	if len(healthy) == 0 {
+		return nil
+	}
+	idx := fnv1aHash(r.URL.Path) % uint32(len(healthy))
+	return healthy[idx]
+}
+
+// fnv1aHash returns a stable fnv-1a hash of s.
+func fnv1aHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// clientIP extracts the client's address, preferring the first hop recorded
+// in X-Forwarded-For and falling back to the connection's RemoteAddr.
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		if ip := strings.TrimSpace(strings.Split(xff, ",")[0]); ip != "" {
+			return ip
+		}
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// StickyConfig controls cookie-based session affinity. When Enabled,
+// ServeHTTP routes a request back to the backend recorded in its affinity
+// cookie, falling through to the configured SelectionPolicy (and issuing a
+// fresh cookie) when the cookie is missing, unrecognized, or unhealthy.
+type StickyConfig struct {
+	Enabled bool `json:"enabled"`
+	// CookieName defaults to "LB_AFFINITY" when empty.
+	CookieName string `json:"cookieName"`
+	// Secret signs the affinity cookie's value (an HMAC of the backend URL)
+	// so clients cannot pin themselves to an arbitrary backend.
+	Secret   string `json:"secret"`
+	Secure   bool   `json:"secure"`
+	HTTPOnly bool   `json:"httpOnly"`
+	// SameSite is one of "lax", "strict", or "none"; defaults to "lax".
+	SameSite string `json:"sameSite"`
+	// Path defaults to "/" when empty.
+	Path string `json:"path"`
+	// MaxAge is the cookie lifetime in seconds; 0 means a session cookie.
+	MaxAge int `json:"maxAge"`
+}
+
+func (c StickyConfig) cookieName() string {
+	if c.CookieName == "" {
+		return "LB_AFFINITY"
+	}
+	return c.CookieName
+}
+
+func (c StickyConfig) path() string {
+	if c.Path == "" {
+		return "/"
+	}
+	return c.Path
+}
+
+func (c StickyConfig) sameSite() http.SameSite {
+	switch c.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// affinityToken returns the opaque cookie value identifying server, an
+// HMAC-SHA256 of its URL keyed by secret. The raw URL is never exposed to
+// the client.
+func affinityToken(secret, serverURL string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(serverURL))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// findServerByToken returns the server whose affinity token matches token,
+// or nil if none match. Comparisons are constant-time.
+func findServerByToken(servers []*Server, secret, token string) *Server {
+	want, err := hex.DecodeString(token)
+	if err != nil {
+		return nil
+	}
+	for _, s := range servers {
+		got, err := hex.DecodeString(affinityToken(secret, s.URL))
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(want, got) {
+			return s
+		}
+	}
+	return nil
+}
+
+// stickyServer returns the backend recorded in r's affinity cookie, if the
+// cookie is present, recognized, and the backend is currently healthy.
+func (lb *LoadBalancer) stickyServer(r *http.Request) *Server {
+	cookie, err := r.Cookie(lb.Sticky.cookieName())
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	lb.Mutex.Lock()
+	servers := lb.Servers
+	lb.Mutex.Unlock()
+
+	server := findServerByToken(servers, lb.Sticky.Secret, cookie.Value)
+	if server == nil {
+		return nil
+	}
+
+	server.Mutex.Lock()
+	available := server.Healthy && !server.Draining
+	server.Mutex.Unlock()
+	if !available {
+		return nil
+	}
+
+	return server
+}
+
+// setAffinityCookie issues a fresh affinity cookie pinning the client to server.
+func (lb *LoadBalancer) setAffinityCookie(w http.ResponseWriter, server *Server) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     lb.Sticky.cookieName(),
+		Value:    affinityToken(lb.Sticky.Secret, server.URL),
+		Path:     lb.Sticky.path(),
+		MaxAge:   lb.Sticky.MaxAge,
+		Secure:   lb.Sticky.Secure,
+		HttpOnly: lb.Sticky.HTTPOnly,
+		SameSite: lb.Sticky.sameSite(),
+	})
+}